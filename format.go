@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/horgh/pop3_check/pop3"
+)
+
+// Result is what checkMailbox found, for a formatter to render.
+type Result struct {
+	CheckedAt    time.Time
+	MessageCount int
+	TotalBytes   int
+	WarnSize     int
+	// Oversize is every message currently larger than WarnSize.
+	Oversize []pop3.Message
+	// NewlyWarned is the subset of Oversize we haven't already warned about
+	// on a previous run (equal to Oversize when -state-file isn't used).
+	NewlyWarned   []pop3.Message
+	QuotaWarnSize int
+	QuotaExceeded bool
+}
+
+// Nagios-style plugin exit codes.
+const (
+	nagiosOK = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+// render writes result in the format args.Format selects and returns the
+// process exit code to use.
+func render(args *argDef, result *Result) int {
+	switch args.Format {
+	case "nagios":
+		return renderNagios(args, result)
+	case "prometheus":
+		return renderPrometheus(args, result)
+	default:
+		return renderText(result)
+	}
+}
+
+// renderText reproduces the tool's original behavior: a log line per
+// newly-oversize message and one if the mailbox is over quota.
+func renderText(result *Result) int {
+	for _, message := range result.NewlyWarned {
+		log.Printf("Warning: Message %d has size %d", message.ID, message.Size)
+	}
+	if result.QuotaExceeded {
+		log.Printf("Warning: Mailbox has total used size: %d", result.TotalBytes)
+	}
+	return nagiosOK
+}
+
+// renderNagios prints a single Nagios/Icinga plugin-style summary line and
+// returns the matching exit code, comparing the oversize message count
+// against -warn-count/-crit-count.
+func renderNagios(args *argDef, result *Result) int {
+	oversize := len(result.Oversize)
+	status := nagiosOK
+	statusName := "OK"
+	if args.CritCount > 0 && oversize >= args.CritCount {
+		status = nagiosCritical
+		statusName = "CRITICAL"
+	} else if args.WarnCount > 0 && oversize >= args.WarnCount {
+		status = nagiosWarning
+		statusName = "WARNING"
+	}
+
+	fmt.Printf(
+		"POP3 %s - %d messages over %s, total %s | messages=%d total_bytes=%d oversize=%d\n",
+		statusName, oversize, humanizeBytes(result.WarnSize), humanizeBytes(result.TotalBytes),
+		result.MessageCount, result.TotalBytes, oversize)
+	return status
+}
+
+// renderPrometheus writes a textfile-collector-compatible file describing
+// the result and returns nagiosUnknown if that fails (there is no
+// meaningful Prometheus exit code equivalent, so we reuse the Nagios
+// scale: 0 means the check and the write both succeeded).
+func renderPrometheus(args *argDef, result *Result) int {
+	metrics := fmt.Sprintf(
+		"# HELP pop3_messages_total Number of messages in the mailbox.\n"+
+			"# TYPE pop3_messages_total gauge\n"+
+			"pop3_messages_total %d\n"+
+			"# HELP pop3_bytes_total Total size in bytes of all messages in the mailbox.\n"+
+			"# TYPE pop3_bytes_total gauge\n"+
+			"pop3_bytes_total %d\n"+
+			"# HELP pop3_oversize_messages Number of messages larger than the configured warning size.\n"+
+			"# TYPE pop3_oversize_messages gauge\n"+
+			"pop3_oversize_messages %d\n"+
+			"# HELP pop3_last_check_timestamp_seconds Unix time of the last check.\n"+
+			"# TYPE pop3_last_check_timestamp_seconds gauge\n"+
+			"pop3_last_check_timestamp_seconds %d\n"+
+			"# HELP pop3_up Whether the last check against the mailbox succeeded.\n"+
+			"# TYPE pop3_up gauge\n"+
+			"pop3_up 1\n",
+		result.MessageCount, result.TotalBytes, len(result.Oversize),
+		result.CheckedAt.Unix())
+
+	if err := atomicWriteFile(args.Textfile, []byte(metrics)); err != nil {
+		log.Printf("Failed to write textfile: %s", err.Error())
+		return nagiosUnknown
+	}
+	return nagiosOK
+}
+
+// renderUnknown reports that checkMailbox itself failed, in the format
+// args.Format selects. text already got a log line for checkErr from
+// checkMailbox, so it just preserves the tool's original exit-1 behavior.
+// nagios prints an UNKNOWN summary line; prometheus overwrites the
+// textfile with pop3_up 0 so the collector doesn't keep serving a stale
+// last-successful-run forever.
+func renderUnknown(args *argDef, checkErr error, checkedAt time.Time) int {
+	switch args.Format {
+	case "nagios":
+		fmt.Printf("POP3 UNKNOWN - %s\n", checkErr.Error())
+		return nagiosUnknown
+	case "prometheus":
+		metrics := fmt.Sprintf(
+			"# HELP pop3_last_check_timestamp_seconds Unix time of the last check.\n"+
+				"# TYPE pop3_last_check_timestamp_seconds gauge\n"+
+				"pop3_last_check_timestamp_seconds %d\n"+
+				"# HELP pop3_up Whether the last check against the mailbox succeeded.\n"+
+				"# TYPE pop3_up gauge\n"+
+				"pop3_up 0\n",
+			checkedAt.Unix())
+		if err := atomicWriteFile(args.Textfile, []byte(metrics)); err != nil {
+			log.Printf("Failed to write textfile: %s", err.Error())
+		}
+		return nagiosUnknown
+	default:
+		return 1
+	}
+}
+
+// humanizeBytes renders n bytes as a whole number of MB, for the
+// human-readable part of plugin output. The perf data alongside it always
+// carries the exact byte counts.
+func humanizeBytes(n int) string {
+	const mb = 1024 * 1024
+	return fmt.Sprintf("%dMB", (n+mb-1)/mb)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/horgh/pop3_check/pop3"
+)
+
+// TestHumanizeBytes checks the MB rounding used in plugin output.
+func TestHumanizeBytes(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0MB"},
+		{1, "1MB"},
+		{1024 * 1024, "1MB"},
+		{1024*1024 + 1, "2MB"},
+		{5 * 1024 * 1024, "5MB"},
+	}
+	for _, test := range tests {
+		if got := humanizeBytes(test.n); got != test.want {
+			t.Errorf("humanizeBytes(%d) = %q, want %q", test.n, got, test.want)
+		}
+	}
+}
+
+// TestRenderNagios checks the warn/crit threshold comparisons and the exit
+// code each produces.
+func TestRenderNagios(t *testing.T) {
+	tests := []struct {
+		name     string
+		oversize int
+		warn     int
+		crit     int
+		wantCode int
+		wantWord string
+	}{
+		{"no thresholds", 5, 0, 0, nagiosOK, "OK"},
+		{"below warn", 1, 2, 4, nagiosOK, "OK"},
+		{"at warn", 2, 2, 4, nagiosWarning, "WARNING"},
+		{"above warn below crit", 3, 2, 4, nagiosWarning, "WARNING"},
+		{"at crit", 4, 2, 4, nagiosCritical, "CRITICAL"},
+		{"above crit", 10, 2, 4, nagiosCritical, "CRITICAL"},
+		{"crit disabled, warn still applies", 5, 2, 0, nagiosWarning, "WARNING"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := &argDef{WarnCount: test.warn, CritCount: test.crit}
+			result := &Result{
+				MessageCount: 10,
+				TotalBytes:   10 * 1024 * 1024,
+				WarnSize:     5 * 1024 * 1024,
+				Oversize:     make([]pop3.Message, test.oversize),
+			}
+
+			var out string
+			var code int
+			withCapturedStdout(t, func() {
+				code = renderNagios(args, result)
+			}, &out)
+
+			if code != test.wantCode {
+				t.Errorf("renderNagios() code = %d, want %d", code, test.wantCode)
+			}
+			if !strings.HasPrefix(out, "POP3 "+test.wantWord) {
+				t.Errorf("renderNagios() output = %q, want prefix %q", out, "POP3 "+test.wantWord)
+			}
+			if !strings.Contains(out, "oversize=") {
+				t.Errorf("renderNagios() output = %q, missing perf data", out)
+			}
+		})
+	}
+}
+
+// TestRenderPrometheus checks that the textfile-collector content reflects
+// the Result, and that a write failure reports nagiosUnknown.
+func TestRenderPrometheus(t *testing.T) {
+	dir := t.TempDir()
+	textfile := filepath.Join(dir, "pop3.prom")
+	checkedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	args := &argDef{Textfile: textfile}
+	result := &Result{
+		CheckedAt:    checkedAt,
+		MessageCount: 3,
+		TotalBytes:   1234,
+		Oversize:     make([]pop3.Message, 2),
+	}
+
+	code := renderPrometheus(args, result)
+	if code != nagiosOK {
+		t.Fatalf("renderPrometheus() code = %d, want %d", code, nagiosOK)
+	}
+
+	data, err := ioutil.ReadFile(textfile)
+	if err != nil {
+		t.Fatalf("reading textfile: %s", err)
+	}
+	content := string(data)
+	for _, want := range []string{
+		"pop3_messages_total 3\n",
+		"pop3_bytes_total 1234\n",
+		"pop3_oversize_messages 2\n",
+		"pop3_up 1\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("textfile content missing %q, got %q", want, content)
+		}
+	}
+
+	// Write failure: point -textfile at a directory that doesn't exist.
+	args.Textfile = filepath.Join(dir, "nonexistent-dir", "pop3.prom")
+	if code := renderPrometheus(args, result); code != nagiosUnknown {
+		t.Errorf("renderPrometheus() with bad path code = %d, want %d", code, nagiosUnknown)
+	}
+}
+
+// TestRenderUnknown checks that a checkMailbox failure is reported in each
+// format, including prometheus overwriting the textfile with pop3_up 0.
+func TestRenderUnknown(t *testing.T) {
+	checkErr := os.ErrDeadlineExceeded
+	checkedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("text", func(t *testing.T) {
+		args := &argDef{Format: "text"}
+		if code := renderUnknown(args, checkErr, checkedAt); code != 1 {
+			t.Errorf("renderUnknown() code = %d, want 1", code)
+		}
+	})
+
+	t.Run("nagios", func(t *testing.T) {
+		args := &argDef{Format: "nagios"}
+		var out string
+		withCapturedStdout(t, func() {
+			if code := renderUnknown(args, checkErr, checkedAt); code != nagiosUnknown {
+				t.Errorf("renderUnknown() code = %d, want %d", code, nagiosUnknown)
+			}
+		}, &out)
+		if !strings.HasPrefix(out, "POP3 UNKNOWN") {
+			t.Errorf("renderUnknown() output = %q, want prefix %q", out, "POP3 UNKNOWN")
+		}
+	})
+
+	t.Run("prometheus", func(t *testing.T) {
+		dir := t.TempDir()
+		textfile := filepath.Join(dir, "pop3.prom")
+		args := &argDef{Format: "prometheus", Textfile: textfile}
+		if code := renderUnknown(args, checkErr, checkedAt); code != nagiosUnknown {
+			t.Errorf("renderUnknown() code = %d, want %d", code, nagiosUnknown)
+		}
+		data, err := ioutil.ReadFile(textfile)
+		if err != nil {
+			t.Fatalf("reading textfile: %s", err)
+		}
+		if !strings.Contains(string(data), "pop3_up 0\n") {
+			t.Errorf("textfile content = %q, want it to contain pop3_up 0", data)
+		}
+	})
+}
+
+// withCapturedStdout runs fn with os.Stdout redirected to a pipe and
+// collects everything written to it into *out.
+func withCapturedStdout(t *testing.T, fn func(), out *string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("creating pipe: %s", err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	fn()
+	w.Close()
+	os.Stdout = orig
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading captured stdout: %s", err)
+	}
+	*out = string(data)
+}
@@ -0,0 +1,438 @@
+/*
+ * connect to a pop3 mailbox and look at the message list.
+ * if there is a message size above a certain threshold, output
+ * a warning.
+ *
+ * why? because I have a pop3 mailbox that gets polled by gmail
+ * which then downloads all the messages. however it appears gmail
+ * will not download messages if they are above a certain size
+ * and the mailbox can then fill up leading to message rejection.
+ * this is to notify about that situation.
+ */
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/horgh/pop3_check/pop3"
+)
+
+type argDef struct {
+	Host  string
+	Port  int
+	User  string
+	Pass  string
+	Size  int
+	Quota int
+
+	// UseTLS means connect via implicit TLS (POP3S).
+	UseTLS bool
+	// UseSTARTTLS means connect in plaintext and then issue STLS to upgrade.
+	UseSTARTTLS bool
+	// TLSSkipVerify disables certificate verification. Insecure.
+	TLSSkipVerify bool
+	// CAFile is an optional path to a PEM file of CA certificates to trust
+	// instead of the system roots.
+	CAFile string
+	// ServerName overrides the hostname used for SNI and certificate
+	// verification.
+	ServerName string
+	// AllowCleartext permits sending credentials over a connection that is
+	// not encrypted.
+	AllowCleartext bool
+
+	// Auth selects the authentication mechanism: auto, user, apop,
+	// cram-md5, plain, or login.
+	Auth string
+
+	// StateFile is the path to a file tracking which message UIDs we've
+	// already warned about, so we only warn about newly arrived oversize
+	// messages. Disabled if empty.
+	StateFile string
+	// DeleteLargerThan, if greater than zero, causes messages larger than
+	// this many bytes to be deleted.
+	DeleteLargerThan int
+	// DeleteOlderThan, if greater than zero, causes messages whose Date
+	// header is older than this to be deleted.
+	DeleteOlderThan time.Duration
+
+	// Format selects how results are rendered: text, nagios, or prometheus.
+	Format string
+	// WarnCount is the oversize message count at or above which -format
+	// nagios reports WARNING. 0 disables the threshold.
+	WarnCount int
+	// CritCount is the oversize message count at or above which -format
+	// nagios reports CRITICAL. 0 disables the threshold.
+	CritCount int
+	// Textfile is where -format prometheus writes its textfile-collector
+	// output.
+	Textfile string
+}
+
+// whether verbose output on or not.
+var verboseOutput = false
+
+// read contents of a file.
+func readFile(path string) (string, error) {
+	if len(path) == 0 {
+		return "", errors.New("invalid path")
+	}
+	fi, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	reader := bufio.NewReader(fi)
+	contents := ""
+	for {
+		// TODO: what encoding is this defaulting to?
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			fi.Close()
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		contents += line
+	}
+	fi.Close()
+	return contents, nil
+}
+
+// getArgs retrieves and validates command line arguments
+func getArgs() (*argDef, error) {
+	host := flag.String("host", "", "POP3 server host")
+	user := flag.String("user", "", "POP3 username")
+	passFile := flag.String("password-file", "", "POP3 password can be found in this file")
+	size := flag.Int("size", 5*1024*1024, "Message size (bytes) above which to warn.")
+	quota := flag.Int("quota", 10*1024*1024, "Size in bytes to above which to warn if the total size of all messages in the mailbox exceeds. This is to warn if we begin to reach quota due to many smaller messages.")
+	verbose := flag.Bool("verbose", false, "Verbose output or not.")
+	port := flag.Int("port", 0, "Port to connect to. Defaults to 995 with -tls, otherwise 110.")
+	useTLS := flag.Bool("tls", false, "Connect using implicit TLS (POP3S).")
+	useSTARTTLS := flag.Bool("starttls", false, "Connect in plaintext and upgrade to TLS via the STLS command.")
+	tlsSkipVerify := flag.Bool("tls-skip-verify", false, "Skip TLS certificate verification. Insecure; for testing only.")
+	caFile := flag.String("ca-file", "", "PEM file of CA certificates to trust instead of the system roots.")
+	serverName := flag.String("server-name", "", "Hostname to use for SNI and certificate verification. Defaults to -host.")
+	allowCleartext := flag.Bool("allow-cleartext", false, "Allow sending credentials over a connection that is not encrypted.")
+	auth := flag.String("auth", "auto", "Authentication mechanism to use: auto, user, apop, cram-md5, plain, or login.")
+	stateFile := flag.String("state-file", "", "Path to a file tracking which message UIDs we've already warned about, so we only warn about newly arrived oversize messages. If not given, every run warns about every oversize message.")
+	deleteLargerThan := flag.Int("delete-larger-than", 0, "Delete messages larger than this many bytes. 0 disables this.")
+	deleteOlderThan := flag.Duration("delete-older-than", 0, "Delete messages whose Date header is older than this, e.g. 720h. 0 disables this.")
+	format := flag.String("format", "text", "Output format: text, nagios, or prometheus.")
+	warnCount := flag.Int("warn-count", 0, "-format nagios: report WARNING once this many messages are oversize. 0 disables the threshold.")
+	critCount := flag.Int("crit-count", 0, "-format nagios: report CRITICAL once this many messages are oversize. 0 disables the threshold.")
+	textfile := flag.String("textfile", "", "-format prometheus: path to write the textfile-collector output to.")
+	flag.Parse()
+	if len(*host) == 0 {
+		errString := "You must provide a host."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	// TODO: better host validation
+	if len(*user) == 0 {
+		errString := "You must provide a username."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	if len(*passFile) == 0 {
+		errString := "You must provide a password file."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	pass, err := readFile(*passFile)
+	if err != nil {
+		errString := fmt.Sprintf("Unable to read password file: %s",
+			err.Error())
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	if *size <= 0 {
+		errString := "You must provide a size larger than zero."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	if *quota <= 0 {
+		errString := "You must provide a quota larger than zero."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	if *verbose {
+		verboseOutput = true
+	}
+	if *useTLS && *useSTARTTLS {
+		errString := "You cannot provide both -tls and -starttls."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	switch *auth {
+	case "auto", "user", "apop", "cram-md5", "plain", "login":
+	default:
+		errString := fmt.Sprintf("Invalid -auth value: %s", *auth)
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	if *deleteLargerThan < 0 {
+		errString := "-delete-larger-than must not be negative."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	if *deleteOlderThan < 0 {
+		errString := "-delete-older-than must not be negative."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	switch *format {
+	case "text", "nagios", "prometheus":
+	default:
+		errString := fmt.Sprintf("Invalid -format value: %s", *format)
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	if *format == "prometheus" && len(*textfile) == 0 {
+		errString := "You must provide -textfile with -format prometheus."
+		log.Print(errString)
+		flag.PrintDefaults()
+		return nil, errors.New(errString)
+	}
+	return &argDef{
+		Host:             *host,
+		User:             *user,
+		Pass:             pass,
+		Size:             *size,
+		Quota:            *quota,
+		UseTLS:           *useTLS,
+		UseSTARTTLS:      *useSTARTTLS,
+		TLSSkipVerify:    *tlsSkipVerify,
+		CAFile:           *caFile,
+		ServerName:       *serverName,
+		AllowCleartext:   *allowCleartext,
+		Auth:             *auth,
+		Port:             *port,
+		StateFile:        *stateFile,
+		DeleteLargerThan: *deleteLargerThan,
+		DeleteOlderThan:  *deleteOlderThan,
+		Format:           *format,
+		WarnCount:        *warnCount,
+		CritCount:        *critCount,
+		Textfile:         *textfile,
+	}, nil
+}
+
+// checkMailbox connects to a POP3 mailbox, lists the messages, and
+// returns a Result describing what it found. It does not log warnings
+// itself; that's the job of a formatter in render().
+func checkMailbox(args *argDef, warnSize int, quotaWarnSize int) (*Result, error) {
+	client, err := pop3.Dial(&pop3.Config{
+		Host:           args.Host,
+		Port:           args.Port,
+		User:           args.User,
+		Pass:           args.Pass,
+		TLS:            args.UseTLS,
+		STARTTLS:       args.UseSTARTTLS,
+		TLSSkipVerify:  args.TLSSkipVerify,
+		CAFile:         args.CAFile,
+		ServerName:     args.ServerName,
+		AllowCleartext: args.AllowCleartext,
+		Auth:           args.Auth,
+		Verbose:        verboseOutput,
+	})
+	if err != nil {
+		log.Printf("Failed to connect and authenticate: %s", err.Error())
+		return nil, err
+	}
+	defer client.Close()
+
+	messages, err := client.List()
+	if err != nil {
+		log.Printf("Failed to list messages: %s", err.Error())
+		return nil, err
+	}
+
+	trackState := len(args.StateFile) > 0
+	var uidls map[int]string
+	var st *State
+	if trackState {
+		uidls, err = client.Uidl()
+		if err != nil {
+			log.Printf("Failed to UIDL messages: %s", err.Error())
+			return nil, err
+		}
+		st, err = loadState(args.StateFile)
+		if err != nil {
+			log.Printf("Failed to load state file: %s", err.Error())
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	seenUIDs := map[string]bool{}
+	result := &Result{
+		CheckedAt:     now,
+		WarnSize:      warnSize,
+		QuotaWarnSize: quotaWarnSize,
+	}
+	for _, message := range messages {
+		if verboseOutput {
+			log.Printf("Message %d has size %d", message.ID, message.Size)
+		}
+		result.MessageCount++
+		result.TotalBytes += message.Size
+
+		oversize := message.Size > warnSize
+		newlyOversize := oversize
+		if trackState {
+			uid := uidls[message.ID]
+			if len(uid) == 0 {
+				// UIDL didn't return an entry for this message (a buggy or
+				// non-conformant server, or a message added/expunged between
+				// our LIST and UIDL commands). We can't key state on an empty
+				// string without every such message colliding on one entry
+				// and suppressing each other's warnings, so treat it as
+				// newly-oversize on every run instead of state-tracking it.
+				if verboseOutput {
+					log.Printf("Message %d has no UIDL entry; not state-tracking it", message.ID)
+				}
+			} else {
+				seenUIDs[uid] = true
+				entry, seen := st.Messages[uid]
+				if !seen {
+					entry = &StateEntry{UID: uid, Size: message.Size, FirstSeen: now}
+					st.Messages[uid] = entry
+				}
+				newlyOversize = oversize && !entry.Warned
+				if oversize {
+					entry.Warned = true
+				}
+			}
+		}
+		if oversize {
+			result.Oversize = append(result.Oversize, message)
+		}
+		if newlyOversize {
+			result.NewlyWarned = append(result.NewlyWarned, message)
+		}
+
+		shouldDelete := args.DeleteLargerThan > 0 && message.Size > args.DeleteLargerThan
+		if !shouldDelete && args.DeleteOlderThan > 0 {
+			old, err := messageOlderThan(client, message.ID, args.DeleteOlderThan, now)
+			if err != nil {
+				if errors.Is(err, errSkipDeletion) {
+					// We can't evaluate this one message's age, but that
+					// shouldn't stop us from checking the rest of the mailbox.
+					log.Printf("Skipping age-based deletion for message %d: %s", message.ID, err.Error())
+				} else {
+					log.Printf("Failed to check age of message %d: %s", message.ID, err.Error())
+					return nil, err
+				}
+			} else {
+				shouldDelete = old
+			}
+		}
+		if shouldDelete {
+			if verboseOutput {
+				log.Printf("Deleting message %d (size %d)", message.ID, message.Size)
+			}
+			if err := client.Dele(message.ID); err != nil {
+				log.Printf("Failed to delete message %d: %s", message.ID, err.Error())
+				return nil, err
+			}
+		}
+	}
+	result.QuotaExceeded = result.TotalBytes > quotaWarnSize
+
+	if trackState {
+		for uid := range st.Messages {
+			if !seenUIDs[uid] {
+				delete(st.Messages, uid)
+			}
+		}
+		if err := saveState(args.StateFile, st); err != nil {
+			log.Printf("Failed to save state file: %s", err.Error())
+			return nil, err
+		}
+	}
+
+	if verboseOutput {
+		log.Printf("Total size of mailbox: %d", result.TotalBytes)
+	}
+
+	if err := client.Quit(); err != nil {
+		log.Printf("Failed to quit cleanly: %s", err.Error())
+		return nil, err
+	}
+	return result, nil
+}
+
+// errSkipDeletion is wrapped by messageOlderThan's error when a message's
+// age can't be determined (no Date header, or an unparseable one). It's
+// a per-message content problem, not a connection/protocol failure, so
+// callers should skip age-based deletion for that message rather than
+// aborting the whole check.
+var errSkipDeletion = errors.New("unable to determine message age")
+
+// messageOlderThan reports whether message id's Date header is older than
+// threshold, fetched via TOP id 0 so we don't download the body.
+func messageOlderThan(client *pop3.Client, id int, threshold time.Duration, now time.Time) (bool, error) {
+	reader, err := client.Top(id, 0)
+	if err != nil {
+		return false, err
+	}
+	// Consume the rest of the response so the next command's reply isn't
+	// read out of the leftover header lines.
+	defer io.Copy(io.Discard, reader)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			break
+		}
+		if !strings.HasPrefix(strings.ToLower(line), "date:") {
+			continue
+		}
+		value := strings.TrimSpace(line[len("Date:"):])
+		date, err := mail.ParseDate(value)
+		if err != nil {
+			return false, fmt.Errorf("%w: unable to parse Date header %q: %s", errSkipDeletion, value, err.Error())
+		}
+		return now.Sub(date) > threshold, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, fmt.Errorf("%w: message has no Date header", errSkipDeletion)
+}
+
+func main() {
+	log.SetFlags(log.Ltime)
+	args, err := getArgs()
+	if err != nil {
+		os.Exit(1)
+	}
+	checkedAt := time.Now()
+	result, err := checkMailbox(args, args.Size, args.Quota)
+	if err != nil {
+		os.Exit(renderUnknown(args, err, checkedAt))
+	}
+	os.Exit(render(args, result))
+}
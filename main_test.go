@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// startFakePop3Server starts an in-process POP3 server that accepts a
+// single connection, sends a greeting, and then replies to each command
+// per script (keyed first by the full line, falling back to just the
+// command word). Each entry is the lines of the response, without CRLF.
+// It returns the address to dial.
+func startFakePop3Server(t *testing.T, script map[string][]string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("+OK fake pop3 server ready\r\n")); err != nil {
+			return
+		}
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+
+			resp, ok := script[line]
+			if !ok {
+				cmd := line
+				if i := strings.Index(line, " "); i >= 0 {
+					cmd = line[:i]
+				}
+				resp, ok = script[cmd]
+			}
+			if !ok {
+				conn.Write([]byte("-ERR unknown command in test script: " + line + "\r\n"))
+				continue
+			}
+			for _, r := range resp {
+				conn.Write([]byte(r + "\r\n"))
+			}
+			if strings.HasPrefix(line, "QUIT") {
+				return
+			}
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// fakeArgs returns an argDef that dials addr and authenticates with plain
+// USER/PASS, skipping the cleartext check since these are test
+// credentials over a loopback socket.
+func fakeArgs(t *testing.T, addr string, stateFile string) *argDef {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("split host port: %s", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parse port: %s", err)
+	}
+	return &argDef{
+		Host:           host,
+		Port:           port,
+		User:           "user",
+		Pass:           "pass",
+		Auth:           "user",
+		AllowCleartext: true,
+		StateFile:      stateFile,
+	}
+}
+
+// baseScript is a CAPA/USER/PASS/QUIT script shared by the state-tracking
+// tests below; each test adds its own LIST/UIDL/DELE entries.
+func baseScript() map[string][]string {
+	return map[string][]string{
+		"CAPA":      {"-ERR not supported"},
+		"USER user": {"+OK"},
+		"PASS pass": {"+OK"},
+		"QUIT":      {"+OK"},
+	}
+}
+
+// TestCheckMailboxWarnOncePerUID checks that once a message has been
+// reported oversize, a later run with the same state file doesn't
+// report it again, but a newly arrived oversize message still is.
+func TestCheckMailboxWarnOncePerUID(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.json")
+
+	script := baseScript()
+	script["LIST"] = []string{"+OK", "1 1000", "."}
+	script["UIDL"] = []string{"+OK", "1 uidA", "."}
+
+	addr := startFakePop3Server(t, script)
+	args := fakeArgs(t, addr, stateFile)
+
+	result, err := checkMailbox(args, 500, 10*1024*1024)
+	if err != nil {
+		t.Fatalf("first checkMailbox: %s", err)
+	}
+	if len(result.NewlyWarned) != 1 {
+		t.Fatalf("first run NewlyWarned = %v, want 1 message", result.NewlyWarned)
+	}
+
+	// Second run: same mailbox, same state file. The message is still
+	// oversize but must not be reported again.
+	addr = startFakePop3Server(t, script)
+	args = fakeArgs(t, addr, stateFile)
+	result, err = checkMailbox(args, 500, 10*1024*1024)
+	if err != nil {
+		t.Fatalf("second checkMailbox: %s", err)
+	}
+	if len(result.Oversize) != 1 {
+		t.Fatalf("second run Oversize = %v, want 1 message", result.Oversize)
+	}
+	if len(result.NewlyWarned) != 0 {
+		t.Fatalf("second run NewlyWarned = %v, want none (already warned)", result.NewlyWarned)
+	}
+
+	// Third run: a new message with a UID we haven't seen arrives. It
+	// must be reported even though the mailbox already has a warned one.
+	script = baseScript()
+	script["LIST"] = []string{"+OK", "1 1000", "2 900", "."}
+	script["UIDL"] = []string{"+OK", "1 uidA", "2 uidB", "."}
+	addr = startFakePop3Server(t, script)
+	args = fakeArgs(t, addr, stateFile)
+	result, err = checkMailbox(args, 500, 10*1024*1024)
+	if err != nil {
+		t.Fatalf("third checkMailbox: %s", err)
+	}
+	if len(result.Oversize) != 2 {
+		t.Fatalf("third run Oversize = %v, want 2 messages", result.Oversize)
+	}
+	if len(result.NewlyWarned) != 1 || result.NewlyWarned[0].ID != 2 {
+		t.Fatalf("third run NewlyWarned = %v, want only message 2", result.NewlyWarned)
+	}
+}
+
+// TestCheckMailboxMissingUIDL checks that a message LIST returns with no
+// matching UIDL entry (a non-conformant server, or a message
+// added/expunged between the two commands) is always reported as
+// newly-oversize instead of being keyed on a shared empty UID.
+func TestCheckMailboxMissingUIDL(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.json")
+
+	script := baseScript()
+	script["LIST"] = []string{"+OK", "1 1000", "2 900", "."}
+	// UIDL is missing message 2 entirely.
+	script["UIDL"] = []string{"+OK", "1 uidA", "."}
+
+	for i := 0; i < 2; i++ {
+		addr := startFakePop3Server(t, script)
+		args := fakeArgs(t, addr, stateFile)
+		result, err := checkMailbox(args, 500, 10*1024*1024)
+		if err != nil {
+			t.Fatalf("run %d: checkMailbox: %s", i, err)
+		}
+		if len(result.Oversize) != 2 {
+			t.Fatalf("run %d: Oversize = %v, want 2 messages", i, result.Oversize)
+		}
+		var gotIDs []int
+		for _, m := range result.NewlyWarned {
+			gotIDs = append(gotIDs, m.ID)
+		}
+		if i == 0 {
+			if len(gotIDs) != 2 {
+				t.Fatalf("run %d: NewlyWarned = %v, want both messages", i, gotIDs)
+			}
+		} else {
+			// Message 1 (uidA) was warned on the previous run and should not
+			// repeat; message 2 has no UID, so it can't be state-tracked and
+			// must be reported every run.
+			if len(gotIDs) != 1 || gotIDs[0] != 2 {
+				t.Fatalf("run %d: NewlyWarned = %v, want only message 2", i, gotIDs)
+			}
+		}
+	}
+}
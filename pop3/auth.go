@@ -0,0 +1,233 @@
+package pop3
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// capabilities holds what the server advertised via CAPA (RFC 2449).
+type capabilities struct {
+	// SASL is the set of mechanisms listed on the SASL capability line, if
+	// any, e.g. {"CRAM-MD5", "PLAIN", "LOGIN"}.
+	SASL map[string]bool
+}
+
+// getCapabilities issues CAPA and parses the multi-line response. Some
+// servers don't implement CAPA at all, in which case we return an empty
+// capabilities value rather than an error so callers can fall back to
+// USER/PASS.
+func getCapabilities(c *conn) (*capabilities, error) {
+	if err := c.writeLine("CAPA"); err != nil {
+		return nil, err
+	}
+	lines, err := c.readLines(func(s string) bool {
+		return s == "." || strings.HasPrefix(s, "-ERR")
+	})
+	if err != nil {
+		return nil, err
+	}
+	caps := &capabilities{SASL: map[string]bool{}}
+	if len(lines) == 0 || strings.HasPrefix(lines[0], "-ERR") {
+		return caps, nil
+	}
+	for _, line := range lines[1:] {
+		if line == "." {
+			continue
+		}
+		fields := strings.Fields(strings.ToUpper(line))
+		if len(fields) > 0 && fields[0] == "SASL" {
+			for _, mech := range fields[1:] {
+				caps.SASL[mech] = true
+			}
+		}
+	}
+	return caps, nil
+}
+
+// greetingTimestamp extracts the "<...>" APOP banner from a POP3 greeting,
+// per RFC 1939 section 7. The second value is false if no banner is
+// present.
+func greetingTimestamp(greeting string) (string, bool) {
+	start := strings.Index(greeting, "<")
+	end := strings.Index(greeting, ">")
+	if start == -1 || end == -1 || end < start {
+		return "", false
+	}
+	return greeting[start : end+1], true
+}
+
+// chooseMechanism picks the strongest mechanism the server supports when
+// the caller asked for "auto", preferring ones that never put the
+// password on the wire: CRAM-MD5, then APOP, then PLAIN/LOGIN, and
+// finally plain USER/PASS.
+func chooseMechanism(requested string, caps *capabilities, haveTimestamp bool) string {
+	if len(requested) > 0 && requested != "auto" {
+		return requested
+	}
+	if caps.SASL["CRAM-MD5"] {
+		return "cram-md5"
+	}
+	if haveTimestamp {
+		return "apop"
+	}
+	if caps.SASL["PLAIN"] {
+		return "plain"
+	}
+	if caps.SASL["LOGIN"] {
+		return "login"
+	}
+	return "user"
+}
+
+// revealsPasswordOnWire reports whether mech sends the password (or
+// something trivially reversible to it) over the connection.
+func revealsPasswordOnWire(mech string) bool {
+	switch mech {
+	case "apop", "cram-md5":
+		return false
+	default:
+		return true
+	}
+}
+
+// authenticate chooses an authentication mechanism based on config.Auth
+// and the server's capabilities, enforces the cleartext policy, and logs
+// in.
+func (client *Client) authenticate(config *Config, greeting string) error {
+	caps, err := getCapabilities(client.conn)
+	if err != nil {
+		return err
+	}
+	timestamp, haveTimestamp := greetingTimestamp(greeting)
+	mech := chooseMechanism(config.Auth, caps, haveTimestamp)
+
+	if !client.conn.tls && revealsPasswordOnWire(mech) && !config.AllowCleartext {
+		return fmt.Errorf("pop3: refusing to authenticate (%s) over a "+
+			"cleartext connection; use TLS/STARTTLS, AllowCleartext, or an "+
+			"auth mechanism that doesn't expose the password", mech)
+	}
+
+	switch mech {
+	case "apop":
+		return authAPOP(client.conn, config.User, config.Pass, timestamp)
+	case "cram-md5":
+		return authCRAMMD5(client.conn, config.User, config.Pass)
+	case "plain":
+		return authPLAIN(client.conn, config.User, config.Pass)
+	case "login":
+		return authLOGIN(client.conn, config.User, config.Pass)
+	case "user":
+		return authUSERPASS(client.conn, config.User, config.Pass)
+	default:
+		return fmt.Errorf("pop3: unknown auth mechanism: %s", mech)
+	}
+}
+
+// readContinuation reads a single "+ <base64>" SASL continuation line and
+// returns the decoded challenge.
+func readContinuation(c *conn) ([]byte, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "+ ") && line != "+" {
+		return nil, fmt.Errorf("pop3: unexpected SASL continuation: %s", line)
+	}
+	encoded := strings.TrimPrefix(strings.TrimPrefix(line, "+"), " ")
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// authUSERPASS authenticates with the plain USER/PASS commands.
+func authUSERPASS(c *conn, user string, pass string) error {
+	if err := c.writeLine(fmt.Sprintf("USER %s", user)); err != nil {
+		return err
+	}
+	if _, err := c.readStatus("USER"); err != nil {
+		return err
+	}
+	if err := c.writeLine(fmt.Sprintf("PASS %s", pass)); err != nil {
+		return err
+	}
+	_, err := c.readStatus("PASS")
+	return err
+}
+
+// authAPOP authenticates using APOP (RFC 1939 section 7):
+// APOP user md5(timestamp+pass).
+func authAPOP(c *conn, user string, pass string, timestamp string) error {
+	if len(timestamp) == 0 {
+		return errors.New("pop3: server did not offer an APOP timestamp in its greeting")
+	}
+	digest := md5.Sum([]byte(timestamp + pass))
+	if err := c.writeLine(fmt.Sprintf("APOP %s %s", user, hex.EncodeToString(digest[:]))); err != nil {
+		return err
+	}
+	_, err := c.readStatus("APOP")
+	return err
+}
+
+// authCRAMMD5 authenticates using AUTH CRAM-MD5 (RFC 2195): the client
+// responds to the server's base64 challenge with
+// base64(user + " " + hex(HMAC-MD5(pass, challenge))).
+func authCRAMMD5(c *conn, user string, pass string) error {
+	if err := c.writeLine("AUTH CRAM-MD5"); err != nil {
+		return err
+	}
+	challenge, err := readContinuation(c)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(md5.New, []byte(pass))
+	mac.Write(challenge)
+	digest := hex.EncodeToString(mac.Sum(nil))
+	response := base64.StdEncoding.EncodeToString([]byte(user + " " + digest))
+	if err := c.writeLine(response); err != nil {
+		return err
+	}
+	_, err = c.readStatus("AUTH CRAM-MD5")
+	return err
+}
+
+// authPLAIN authenticates using AUTH PLAIN (RFC 4616):
+// base64("\0" + user + "\0" + pass).
+func authPLAIN(c *conn, user string, pass string) error {
+	if err := c.writeLine("AUTH PLAIN"); err != nil {
+		return err
+	}
+	if _, err := readContinuation(c); err != nil {
+		return err
+	}
+	response := base64.StdEncoding.EncodeToString([]byte("\x00" + user + "\x00" + pass))
+	if err := c.writeLine(response); err != nil {
+		return err
+	}
+	_, err := c.readStatus("AUTH PLAIN")
+	return err
+}
+
+// authLOGIN authenticates using AUTH LOGIN: the server prompts for a
+// base64-encoded username, then a base64-encoded password.
+func authLOGIN(c *conn, user string, pass string) error {
+	if err := c.writeLine("AUTH LOGIN"); err != nil {
+		return err
+	}
+	if _, err := readContinuation(c); err != nil {
+		return err
+	}
+	if err := c.writeLine(base64.StdEncoding.EncodeToString([]byte(user))); err != nil {
+		return err
+	}
+	if _, err := readContinuation(c); err != nil {
+		return err
+	}
+	if err := c.writeLine(base64.StdEncoding.EncodeToString([]byte(pass))); err != nil {
+		return err
+	}
+	_, err := c.readStatus("AUTH LOGIN")
+	return err
+}
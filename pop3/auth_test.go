@@ -0,0 +1,307 @@
+package pop3
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startRawFakeServer starts an in-process TCP server that accepts a single
+// connection and hands it to handler as a *conn, for tests that need to
+// compute a response dynamically (e.g. verifying a SASL digest) rather
+// than script a fixed reply.
+func startRawFakeServer(t *testing.T, handler func(c *conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	go func() {
+		defer ln.Close()
+		rawConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer rawConn.Close()
+		handler(newConn(rawConn, false, false, 5*time.Second))
+	}()
+
+	return ln.Addr().String()
+}
+
+// dialWithConfig fills in config's Host/Port from addr and dials it.
+func dialWithConfig(t *testing.T, addr string, config *Config) (*Client, error) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("split host port: %s", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parse port: %s", err)
+	}
+	config.Host = host
+	config.Port = port
+	return Dial(config)
+}
+
+// expectCAPA reads a CAPA command and responds that it isn't supported, so
+// the client falls back to whatever mechanism it was explicitly configured
+// with.
+func expectCAPA(c *conn) bool {
+	line, err := c.readLine()
+	if err != nil || line != "CAPA" {
+		return false
+	}
+	return c.writeLine("-ERR not supported") == nil
+}
+
+func TestAuthAPOP(t *testing.T) {
+	const user = "user"
+	const pass = "pass"
+	const timestamp = "<12345.1620000000@example.com>"
+
+	addr := startRawFakeServer(t, func(c *conn) {
+		if c.writeLine("+OK POP3 ready "+timestamp) != nil {
+			return
+		}
+		if !expectCAPA(c) {
+			return
+		}
+		line, err := c.readLine()
+		if err != nil {
+			return
+		}
+		digest := md5.Sum([]byte(timestamp + pass))
+		want := fmt.Sprintf("APOP %s %s", user, hex.EncodeToString(digest[:]))
+		if line != want {
+			c.writeLine(fmt.Sprintf("-ERR expected %q, got %q", want, line))
+			return
+		}
+		c.writeLine("+OK authenticated")
+	})
+
+	client, err := dialWithConfig(t, addr, &Config{User: user, Pass: pass, Auth: "apop"})
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	client.Close()
+}
+
+func TestAuthCRAMMD5(t *testing.T) {
+	const user = "user"
+	const pass = "pass"
+	const challenge = "<1896.697170952@postoffice.example.net>"
+
+	addr := startRawFakeServer(t, func(c *conn) {
+		if c.writeLine("+OK ready") != nil {
+			return
+		}
+		if !expectCAPA(c) {
+			return
+		}
+		line, err := c.readLine()
+		if err != nil || line != "AUTH CRAM-MD5" {
+			return
+		}
+		if c.writeLine("+ "+base64.StdEncoding.EncodeToString([]byte(challenge))) != nil {
+			return
+		}
+		line, err = c.readLine()
+		if err != nil {
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return
+		}
+		mac := hmac.New(md5.New, []byte(pass))
+		mac.Write([]byte(challenge))
+		want := user + " " + hex.EncodeToString(mac.Sum(nil))
+		if string(decoded) != want {
+			c.writeLine(fmt.Sprintf("-ERR expected %q, got %q", want, decoded))
+			return
+		}
+		c.writeLine("+OK authenticated")
+	})
+
+	client, err := dialWithConfig(t, addr, &Config{User: user, Pass: pass, Auth: "cram-md5"})
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	client.Close()
+}
+
+func TestAuthPLAIN(t *testing.T) {
+	const user = "user"
+	const pass = "pass"
+
+	addr := startRawFakeServer(t, func(c *conn) {
+		if c.writeLine("+OK ready") != nil {
+			return
+		}
+		if !expectCAPA(c) {
+			return
+		}
+		line, err := c.readLine()
+		if err != nil || line != "AUTH PLAIN" {
+			return
+		}
+		if c.writeLine("+ ") != nil {
+			return
+		}
+		line, err = c.readLine()
+		if err != nil {
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return
+		}
+		want := "\x00" + user + "\x00" + pass
+		if string(decoded) != want {
+			c.writeLine(fmt.Sprintf("-ERR expected %q, got %q", want, decoded))
+			return
+		}
+		c.writeLine("+OK authenticated")
+	})
+
+	client, err := dialWithConfig(t, addr, &Config{
+		User:           user,
+		Pass:           pass,
+		Auth:           "plain",
+		AllowCleartext: true,
+	})
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	client.Close()
+}
+
+func TestAuthLOGIN(t *testing.T) {
+	const user = "user"
+	const pass = "pass"
+
+	addr := startRawFakeServer(t, func(c *conn) {
+		if c.writeLine("+OK ready") != nil {
+			return
+		}
+		if !expectCAPA(c) {
+			return
+		}
+		line, err := c.readLine()
+		if err != nil || line != "AUTH LOGIN" {
+			return
+		}
+		if c.writeLine("+ "+base64.StdEncoding.EncodeToString([]byte("Username:"))) != nil {
+			return
+		}
+		line, err = c.readLine()
+		if err != nil {
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || string(decoded) != user {
+			c.writeLine("-ERR bad username")
+			return
+		}
+		if c.writeLine("+ "+base64.StdEncoding.EncodeToString([]byte("Password:"))) != nil {
+			return
+		}
+		line, err = c.readLine()
+		if err != nil {
+			return
+		}
+		decoded, err = base64.StdEncoding.DecodeString(line)
+		if err != nil || string(decoded) != pass {
+			c.writeLine("-ERR bad password")
+			return
+		}
+		c.writeLine("+OK authenticated")
+	})
+
+	client, err := dialWithConfig(t, addr, &Config{
+		User:           user,
+		Pass:           pass,
+		Auth:           "login",
+		AllowCleartext: true,
+	})
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	client.Close()
+}
+
+// TestAuthenticateRefusesCleartextWithoutAllow confirms the cleartext gate
+// in authenticate(): a mechanism that reveals the password must not run
+// over a non-TLS connection unless the caller opted in via AllowCleartext.
+func TestAuthenticateRefusesCleartextWithoutAllow(t *testing.T) {
+	addr := startRawFakeServer(t, func(c *conn) {
+		if c.writeLine("+OK ready") != nil {
+			return
+		}
+		expectCAPA(c)
+		// The client should give up after CAPA; there's nothing further to
+		// script.
+	})
+
+	_, err := dialWithConfig(t, addr, &Config{User: "user", Pass: "pass", Auth: "plain"})
+	if err == nil {
+		t.Fatal("Dial succeeded, want an error refusing cleartext PLAIN")
+	}
+	if !strings.Contains(err.Error(), "refusing") {
+		t.Fatalf("Dial error = %q, want it to mention refusing cleartext auth", err.Error())
+	}
+}
+
+func TestChooseMechanism(t *testing.T) {
+	cases := []struct {
+		name          string
+		requested     string
+		caps          *capabilities
+		haveTimestamp bool
+		want          string
+	}{
+		{"explicit mechanism wins over capabilities", "login", &capabilities{SASL: map[string]bool{"CRAM-MD5": true}}, true, "login"},
+		{"auto prefers CRAM-MD5", "auto", &capabilities{SASL: map[string]bool{"CRAM-MD5": true, "PLAIN": true}}, true, "cram-md5"},
+		{"auto falls back to APOP", "auto", &capabilities{SASL: map[string]bool{}}, true, "apop"},
+		{"auto falls back to PLAIN", "auto", &capabilities{SASL: map[string]bool{"PLAIN": true}}, false, "plain"},
+		{"auto falls back to LOGIN", "auto", &capabilities{SASL: map[string]bool{"LOGIN": true}}, false, "login"},
+		{"auto falls back to USER/PASS", "auto", &capabilities{SASL: map[string]bool{}}, false, "user"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := chooseMechanism(c.requested, c.caps, c.haveTimestamp)
+			if got != c.want {
+				t.Fatalf("chooseMechanism(%q, %v, %v) = %q, want %q",
+					c.requested, c.caps, c.haveTimestamp, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRevealsPasswordOnWire(t *testing.T) {
+	cases := []struct {
+		mech string
+		want bool
+	}{
+		{"apop", false},
+		{"cram-md5", false},
+		{"plain", true},
+		{"login", true},
+		{"user", true},
+	}
+	for _, c := range cases {
+		if got := revealsPasswordOnWire(c.mech); got != c.want {
+			t.Fatalf("revealsPasswordOnWire(%q) = %v, want %v", c.mech, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package pop3 implements a POP3 (RFC 1939) client, including the STARTTLS
+// (RFC 2595) and CAPA (RFC 2449) extensions and the APOP, CRAM-MD5, PLAIN,
+// and LOGIN authentication mechanisms.
+package pop3
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPlainPort = 110
+	defaultTLSPort   = 995
+)
+
+// Config configures how Dial connects and authenticates to a POP3 server.
+type Config struct {
+	Host string
+	// Port is the TCP port to connect to. If zero, it defaults to 995 when
+	// TLS is requested, otherwise 110.
+	Port int
+	User string
+	Pass string
+
+	// TLS connects using implicit TLS (POP3S).
+	TLS bool
+	// STARTTLS connects in plaintext and upgrades via the STLS command
+	// before authenticating. Mutually exclusive with TLS.
+	STARTTLS bool
+	// TLSSkipVerify disables certificate verification. Insecure; for
+	// testing only.
+	TLSSkipVerify bool
+	// CAFile is an optional path to a PEM file of CA certificates to trust
+	// instead of the system roots.
+	CAFile string
+	// ServerName overrides the hostname used for SNI and certificate
+	// verification. Defaults to Host.
+	ServerName string
+	// AllowCleartext permits authentication mechanisms that reveal the
+	// password to run over a connection that is not encrypted.
+	AllowCleartext bool
+
+	// Auth selects the authentication mechanism: "auto" (the default),
+	// "user", "apop", "cram-md5", "plain", or "login".
+	Auth string
+
+	// ReadTimeout is the deadline applied to each read from the server.
+	// Defaults to 5 seconds.
+	ReadTimeout time.Duration
+
+	// Verbose enables protocol-level logging.
+	Verbose bool
+}
+
+// Client is an authenticated connection to a POP3 mailbox.
+type Client struct {
+	conn *conn
+}
+
+// Dial connects to the server described by config, negotiates TLS if
+// requested, and authenticates. The returned Client is ready to issue
+// mailbox commands.
+func Dial(config *Config) (*Client, error) {
+	if config.TLS && config.STARTTLS {
+		return nil, errors.New("pop3: TLS and STARTTLS are mutually exclusive")
+	}
+
+	port := config.Port
+	if port == 0 {
+		if config.TLS {
+			port = defaultTLSPort
+		} else {
+			port = defaultPlainPort
+		}
+	}
+	readTimeout := config.ReadTimeout
+	if readTimeout == 0 {
+		readTimeout = 5 * time.Second
+	}
+
+	c, err := dialTransport(config, port, readTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{conn: c}
+
+	greeting, err := client.conn.readLine()
+	if err != nil {
+		client.conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		client.conn.Close()
+		return nil, fmt.Errorf("pop3: invalid greeting: %s", greeting)
+	}
+
+	if config.STARTTLS {
+		if err := startTLS(client.conn, config); err != nil {
+			client.conn.Close()
+			return nil, err
+		}
+	}
+
+	if err := client.authenticate(config, greeting); err != nil {
+		client.conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// dialTransport connects to the server using whichever transport the
+// caller asked for (implicit TLS or plaintext). Once this returns, the
+// rest of the protocol code does not need to know which transport is in
+// use.
+func dialTransport(config *Config, port int, readTimeout time.Duration) (*conn, error) {
+	hostPort := fmt.Sprintf("%s:%d", config.Host, port)
+
+	if config.TLS {
+		tlsConfig, err := buildTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		transport, err := tls.Dial("tcp4", hostPort, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("pop3: failed to connect to %s: %s", hostPort, err.Error())
+		}
+		return newConn(transport, true, config.Verbose, readTimeout), nil
+	}
+
+	transport, err := net.Dial("tcp4", hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("pop3: failed to connect to %s: %s", hostPort, err.Error())
+	}
+	return newConn(transport, false, config.Verbose, readTimeout), nil
+}
+
+// buildTLSConfig constructs the *tls.Config to use for implicit TLS or
+// STLS based on config.
+func buildTLSConfig(config *Config) (*tls.Config, error) {
+	name := config.ServerName
+	if len(name) == 0 {
+		name = config.Host
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         name,
+		InsecureSkipVerify: config.TLSSkipVerify,
+	}
+	if len(config.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("pop3: unable to read CA file: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("pop3: unable to parse any certificates from CA file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// startTLS issues the STLS command (RFC 2595) and upgrades c in place to
+// use TLS. It must be called right after the greeting, before any other
+// command.
+func startTLS(c *conn, config *Config) error {
+	if err := c.writeLine("STLS"); err != nil {
+		return err
+	}
+	if _, err := c.readStatus("STLS"); err != nil {
+		return err
+	}
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		return err
+	}
+	tlsConn := tls.Client(c.transport, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("pop3: STLS handshake failure: %s", err.Error())
+	}
+	c.upgrade(tlsConn)
+	return nil
+}
+
+// Close closes the underlying connection without sending QUIT. Prefer
+// Quit, which commits deletions; Close is for abandoning a session after
+// an error.
+func (client *Client) Close() error {
+	return client.conn.Close()
+}
@@ -0,0 +1,179 @@
+package pop3
+
+import (
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startFakeServer starts an in-process POP3 server that accepts a single
+// connection, sends greeting, and then replies to each command per script
+// (keyed first by the full line, falling back to just the command word).
+// Each entry is the lines of the response, without CRLF. It returns the
+// address to dial.
+func startFakeServer(t *testing.T, script map[string][]string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("+OK fake pop3 server ready\r\n")); err != nil {
+			return
+		}
+
+		c := newConn(conn, false, false, 5*time.Second)
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return
+			}
+			resp, ok := script[line]
+			if !ok {
+				cmd := line
+				if i := strings.Index(line, " "); i >= 0 {
+					cmd = line[:i]
+				}
+				resp, ok = script[cmd]
+			}
+			if !ok {
+				c.writeLine("-ERR unknown command in test script: " + line)
+				continue
+			}
+			for _, r := range resp {
+				c.writeLine(r)
+			}
+			if strings.HasPrefix(line, "QUIT") {
+				return
+			}
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// dialFake connects to addr and authenticates with plain USER/PASS,
+// skipping the cleartext check since these are test credentials over a
+// loopback socket.
+func dialFake(t *testing.T, addr string) *Client {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("split host port: %s", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parse port: %s", err)
+	}
+	client, err := Dial(&Config{
+		Host:           host,
+		Port:           port,
+		User:           "user",
+		Pass:           "pass",
+		Auth:           "user",
+		AllowCleartext: true,
+	})
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	return client
+}
+
+// TestClientCommands exercises STAT, LIST, UIDL, TOP, RETR, and DELE
+// against a fake server, including RETR's dot-unstuffing of a body line
+// that begins with a literal "." and a folded header continuation whose
+// leading whitespace must survive unstuffing.
+func TestClientCommands(t *testing.T) {
+	addr := startFakeServer(t, map[string][]string{
+		"CAPA":      {"-ERR not supported"},
+		"USER user": {"+OK"},
+		"PASS pass": {"+OK"},
+		"STAT":      {"+OK 2 300"},
+		"LIST":      {"+OK", "1 100", "2 200", "."},
+		"UIDL":      {"+OK", "1 uid1", "2 uid2", "."},
+		"TOP 1 0":   {"+OK top of message", "Subject: hi", "."},
+		"RETR 2": {
+			"+OK retrieving message",
+			"Subject: test",
+			"   continuation of a folded header",
+			"",
+			"Hello",
+			"..filename", // dot-stuffed ".filename"
+			".",
+		},
+		"DELE 1": {"+OK"},
+		"QUIT":   {"+OK"},
+	})
+
+	client := dialFake(t, addr)
+	defer client.Close()
+
+	count, size, err := client.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %s", err)
+	}
+	if count != 2 || size != 300 {
+		t.Fatalf("Stat returned (%d, %d), want (2, 300)", count, size)
+	}
+
+	messages, err := client.List()
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	want := []Message{{ID: 1, Size: 100}, {ID: 2, Size: 200}}
+	if len(messages) != len(want) || messages[0] != want[0] || messages[1] != want[1] {
+		t.Fatalf("List returned %v, want %v", messages, want)
+	}
+
+	uidls, err := client.Uidl()
+	if err != nil {
+		t.Fatalf("Uidl: %s", err)
+	}
+	if uidls[1] != "uid1" || uidls[2] != "uid2" {
+		t.Fatalf("Uidl returned %v, want map[1:uid1 2:uid2]", uidls)
+	}
+
+	top, err := client.Top(1, 0)
+	if err != nil {
+		t.Fatalf("Top: %s", err)
+	}
+	topBody, err := ioutil.ReadAll(top)
+	if err != nil {
+		t.Fatalf("reading Top body: %s", err)
+	}
+	if string(topBody) != "Subject: hi\n" {
+		t.Fatalf("Top body = %q, want %q", topBody, "Subject: hi\n")
+	}
+
+	retr, err := client.Retr(2)
+	if err != nil {
+		t.Fatalf("Retr: %s", err)
+	}
+	retrBody, err := ioutil.ReadAll(retr)
+	if err != nil {
+		t.Fatalf("reading Retr body: %s", err)
+	}
+	wantBody := "Subject: test\n   continuation of a folded header\n\nHello\n.filename\n"
+	if string(retrBody) != wantBody {
+		t.Fatalf("Retr body = %q, want %q (dot-unstuffing or whitespace handling failed)", retrBody, wantBody)
+	}
+
+	if err := client.Dele(1); err != nil {
+		t.Fatalf("Dele: %s", err)
+	}
+
+	if err := client.Quit(); err != nil {
+		t.Fatalf("Quit: %s", err)
+	}
+}
@@ -0,0 +1,162 @@
+package pop3
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Message describes one entry from a LIST response.
+type Message struct {
+	ID   int
+	Size int
+}
+
+// Stat issues the STAT command and returns the number of messages in the
+// mailbox and their total size in bytes.
+func (client *Client) Stat() (int, int, error) {
+	resp, err := client.command("STAT")
+	if err != nil {
+		return 0, 0, err
+	}
+	var count, size int
+	n, err := fmt.Sscanf(resp, "%d %d", &count, &size)
+	if err != nil || n != 2 {
+		return 0, 0, fmt.Errorf("pop3: unable to parse STAT response: %q", resp)
+	}
+	return count, size, nil
+}
+
+// List issues the LIST command and returns the id and size of every
+// message in the mailbox.
+func (client *Client) List() ([]Message, error) {
+	lines, err := client.multilineCommand("LIST")
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(lines))
+	for _, line := range lines {
+		var id, size int
+		n, err := fmt.Sscanf(line, "%d %d", &id, &size)
+		if err != nil || n != 2 {
+			return nil, fmt.Errorf("pop3: unable to parse LIST line: %q", line)
+		}
+		messages = append(messages, Message{ID: id, Size: size})
+	}
+	return messages, nil
+}
+
+// Uidl issues the UIDL command and returns a map of message id to unique
+// id (RFC 1939 section 7).
+func (client *Client) Uidl() (map[int]string, error) {
+	lines, err := client.multilineCommand("UIDL")
+	if err != nil {
+		return nil, err
+	}
+	uidls := make(map[int]string, len(lines))
+	for _, line := range lines {
+		fields := strings.SplitN(line, " ", 2)
+		var id int
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("pop3: unable to parse UIDL line: %q", line)
+		}
+		if _, err := fmt.Sscanf(fields[0], "%d", &id); err != nil {
+			return nil, fmt.Errorf("pop3: unable to parse UIDL line: %q", line)
+		}
+		uidls[id] = fields[1]
+	}
+	return uidls, nil
+}
+
+// Top issues the TOP command, retrieving the headers and the first n
+// lines of the body of message id. The returned Reader streams the
+// response and transparently undoes dot-stuffing (RFC 1939 section 3).
+func (client *Client) Top(id int, n int) (io.Reader, error) {
+	return client.streamingCommand(fmt.Sprintf("TOP %d %d", id, n))
+}
+
+// Retr issues the RETR command, retrieving message id in full. The
+// returned Reader streams the response and transparently undoes
+// dot-stuffing (RFC 1939 section 3).
+func (client *Client) Retr(id int) (io.Reader, error) {
+	return client.streamingCommand(fmt.Sprintf("RETR %d", id))
+}
+
+// Dele marks message id for deletion. The deletion only takes effect once
+// Quit is called.
+func (client *Client) Dele(id int) error {
+	_, err := client.command(fmt.Sprintf("DELE %d", id))
+	return err
+}
+
+// Noop issues the NOOP command.
+func (client *Client) Noop() error {
+	_, err := client.command("NOOP")
+	return err
+}
+
+// Rset unmarks any messages marked for deletion this session.
+func (client *Client) Rset() error {
+	_, err := client.command("RSET")
+	return err
+}
+
+// Quit issues the QUIT command, which commits any deletions, and closes
+// the connection.
+func (client *Client) Quit() error {
+	_, err := client.command("QUIT")
+	closeErr := client.conn.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// command writes a single-line command and returns the text of its +OK
+// response.
+func (client *Client) command(s string) (string, error) {
+	if err := client.conn.writeLine(s); err != nil {
+		return "", err
+	}
+	return client.conn.readStatus(s)
+}
+
+// multilineCommand writes a command and returns the lines of its
+// multi-line response, excluding the leading +OK and the terminating ".".
+func (client *Client) multilineCommand(s string) ([]string, error) {
+	if err := client.conn.writeLine(s); err != nil {
+		return nil, err
+	}
+	first, err := client.conn.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(first, "-ERR") {
+		return nil, &ProtocolError{Command: s, Response: first}
+	}
+	if !strings.HasPrefix(first, "+OK") {
+		return nil, fmt.Errorf("pop3: unexpected response to %s: %s", s, first)
+	}
+	lines, err := client.conn.readLines(func(s string) bool {
+		return s == "."
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) > 0 && lines[len(lines)-1] == "." {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, nil
+}
+
+// streamingCommand writes a command whose response body is a dot-stuffed
+// message and returns an io.Reader over it.
+func (client *Client) streamingCommand(s string) (io.Reader, error) {
+	if err := client.conn.writeLine(s); err != nil {
+		return nil, err
+	}
+	if _, err := client.conn.readStatus(s); err != nil {
+		return nil, err
+	}
+	return newDotReader(client.conn), nil
+}
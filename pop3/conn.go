@@ -0,0 +1,174 @@
+package pop3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxLineLength is the maximum number of bytes we will buffer for a single
+// line from the server. Without a cap, a malicious or broken server could
+// withhold the trailing \n forever and force us to buffer an unbounded
+// amount of memory.
+const maxLineLength = 8192
+
+// conn is the transport-agnostic, line-oriented connection the rest of the
+// package speaks the protocol over. Once it is set up, callers do not need
+// to know whether it is plaintext, implicit TLS, or upgraded via STLS.
+type conn struct {
+	readWriter   *bufio.ReadWriter
+	transport    net.Conn
+	tls          bool
+	verbose      bool
+	readDeadline time.Duration
+}
+
+// newConn wraps transport in a conn. isTLS records whether the transport is
+// already encrypted (implicit TLS); plaintext connections that are later
+// upgraded via STLS should call upgrade().
+func newConn(transport net.Conn, isTLS bool, verbose bool, readDeadline time.Duration) *conn {
+	reader := bufio.NewReader(transport)
+	writer := bufio.NewWriter(transport)
+	return &conn{
+		readWriter:   bufio.NewReadWriter(reader, writer),
+		transport:    transport,
+		tls:          isTLS,
+		verbose:      verbose,
+		readDeadline: readDeadline,
+	}
+}
+
+// upgrade replaces the connection's underlying transport with newTransport
+// (normally a *tls.Conn produced by STLS) and resets the buffered
+// reader/writer to read/write through it.
+func (c *conn) upgrade(newTransport net.Conn) {
+	c.transport = newTransport
+	reader := bufio.NewReader(newTransport)
+	writer := bufio.NewWriter(newTransport)
+	c.readWriter = bufio.NewReadWriter(reader, writer)
+	c.tls = true
+}
+
+// Close closes the connection.
+func (c *conn) Close() error {
+	return c.transport.Close()
+}
+
+// setReadDeadline sets a read deadline on the connection. this is
+// something we will do often so contain it in a function.
+func (c *conn) setReadDeadline() {
+	c.transport.SetReadDeadline(time.Now().Add(c.readDeadline))
+}
+
+// readLineBytes reads a single line from the connection, enforcing
+// maxLineLength, and returns it without the trailing newline.
+func (c *conn) readLineBytes() ([]byte, error) {
+	c.setReadDeadline()
+	// read byte by byte so we can bail out as soon as we exceed
+	// maxLineLength, rather than after an unbounded buffer has already been
+	// allocated.
+	var buf []byte
+	for {
+		b, err := c.readWriter.Reader.ReadByte()
+		if err != nil {
+			if c.verbose {
+				log.Printf("pop3: read failure: %s", err.Error())
+			}
+			return nil, err
+		}
+		if b == '\n' {
+			break
+		}
+		buf = append(buf, b)
+		if len(buf) > maxLineLength {
+			if c.verbose {
+				log.Printf("pop3: line exceeds maximum length of %d bytes", maxLineLength)
+			}
+			return nil, ErrLineTooLong
+		}
+	}
+	return buf, nil
+}
+
+// readLine reads a single protocol control line (a status response, a CAPA
+// line, a SASL continuation) and trims surrounding whitespace, which that
+// grammar doesn't care about. It must not be used for message body content,
+// where leading/trailing whitespace can be meaningful; use readRawLine for
+// that.
+func (c *conn) readLine() (string, error) {
+	buf, err := c.readLineBytes()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// readRawLine reads a single line of a multi-line response body (TOP/RETR),
+// stripping only the trailing CRLF so that meaningful leading whitespace --
+// folded header continuations, quoted text, indented content -- survives.
+func (c *conn) readRawLine() (string, error) {
+	buf, err := c.readLineBytes()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(buf), "\r"), nil
+}
+
+// readLines reads lines until EOF/timeout/error. endCheck is a function we
+// run on each line that tells us we can return if it returns true.
+func (c *conn) readLines(endCheck func(string) bool) ([]string, error) {
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			// a timeout or EOF is acceptable: we keep trying to read even after
+			// the server has sent its last line, so we will time out there if
+			// endCheck never fires.
+			netErr, ok := err.(net.Error)
+			if ok && netErr.Timeout() {
+				break
+			}
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		lines = append(lines, line)
+		if endCheck(line) {
+			return lines, nil
+		}
+	}
+	return lines, nil
+}
+
+// writeLine writes a line to the connection, adding CRLF, and flushes.
+func (c *conn) writeLine(s string) error {
+	if c.verbose {
+		log.Printf("pop3: writing line [%s]", s)
+	}
+	if _, err := c.readWriter.Writer.WriteString(s + "\r\n"); err != nil {
+		return err
+	}
+	return c.readWriter.Writer.Flush()
+}
+
+// readStatus reads a single-line response and returns the text following
+// +OK, or a *ProtocolError if the server replied -ERR.
+func (c *conn) readStatus(command string) (string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(line, "+OK"):
+		return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+	case strings.HasPrefix(line, "-ERR"):
+		return "", &ProtocolError{Command: command, Response: line}
+	default:
+		return "", fmt.Errorf("pop3: unexpected response to %s: %s", command, line)
+	}
+}
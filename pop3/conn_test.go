@@ -0,0 +1,46 @@
+package pop3
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReadLineTooLong starts an in-process fake server that sends a single
+// line far longer than maxLineLength and never terminates it, and checks
+// that readLine gives up promptly with ErrLineTooLong instead of buffering
+// the whole thing.
+func TestReadLineTooLong(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte(strings.Repeat("a", 1024*1024))); err != nil {
+			return
+		}
+		// Block until the client disconnects, rather than closing our end
+		// and potentially racing the client's read of the bytes above.
+		buf := make([]byte, 1)
+		conn.Read(buf)
+	}()
+
+	transport, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer transport.Close()
+
+	c := newConn(transport, false, false, time.Second)
+	if _, err := c.readLine(); err != ErrLineTooLong {
+		t.Fatalf("readLine returned %v, want ErrLineTooLong", err)
+	}
+}
@@ -0,0 +1,20 @@
+package pop3
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLineTooLong is returned when the server sends a line longer than
+// maxLineLength without a terminating \n.
+var ErrLineTooLong = errors.New("pop3: line exceeds maximum length")
+
+// ProtocolError is returned when the server replies -ERR to a command.
+type ProtocolError struct {
+	Command  string
+	Response string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("pop3: %s: %s", e.Command, e.Response)
+}
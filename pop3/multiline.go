@@ -0,0 +1,49 @@
+package pop3
+
+import (
+	"io"
+	"strings"
+)
+
+// dotReader streams a multi-line, dot-stuffed POP3 response body (RFC
+// 1939 section 3), undoing the stuffing and stopping at the terminating
+// line containing only ".". This lets callers stream large messages (e.g.
+// via RETR) without buffering the whole thing.
+type dotReader struct {
+	conn *conn
+	buf  []byte
+	done bool
+	err  error
+}
+
+func newDotReader(c *conn) *dotReader {
+	return &dotReader{conn: c}
+}
+
+func (r *dotReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 && !r.done {
+		line, err := r.conn.readRawLine()
+		if err != nil {
+			r.done = true
+			r.err = err
+			break
+		}
+		if line == "." {
+			r.done = true
+			break
+		}
+		if strings.HasPrefix(line, ".") {
+			line = line[1:]
+		}
+		r.buf = []byte(line + "\n")
+	}
+	if len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
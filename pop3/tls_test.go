@@ -0,0 +1,242 @@
+package pop3
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// generateSelfSignedCert returns a self-signed certificate (and its PEM
+// encoding) valid for ipAddr, for standing up an in-process TLS fake
+// server.
+func generateSelfSignedCert(t *testing.T, ipAddr string) (tls.Certificate, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: ipAddr},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP(ipAddr)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %s", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair: %s", err)
+	}
+	return cert, certPEM
+}
+
+// serveUserPassSession runs a scripted USER/PASS/QUIT exchange over c,
+// after the caller has already sent the greeting and handled CAPA.
+func serveUserPassSession(c *conn) {
+	line, err := c.readLine()
+	if err != nil || line != "USER user" {
+		return
+	}
+	if c.writeLine("+OK") != nil {
+		return
+	}
+	line, err = c.readLine()
+	if err != nil || line != "PASS pass" {
+		return
+	}
+	if c.writeLine("+OK") != nil {
+		return
+	}
+	line, err = c.readLine()
+	if err != nil || line != "QUIT" {
+		return
+	}
+	c.writeLine("+OK")
+}
+
+func splitHostPortInt(t *testing.T, addr string) (string, int) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("split host port: %s", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parse port: %s", err)
+	}
+	return host, port
+}
+
+// TestDialImplicitTLS dials a fake POP3S server over implicit TLS, trusting
+// its certificate via -ca-file (exercising buildTLSConfig's CAFile branch)
+// rather than -tls-skip-verify.
+func TestDialImplicitTLS(t *testing.T) {
+	cert, certPEM := generateSelfSignedCert(t, "127.0.0.1")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("write CA file: %s", err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	go func() {
+		defer ln.Close()
+		rawConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer rawConn.Close()
+		c := newConn(rawConn, true, false, 5*time.Second)
+		if c.writeLine("+OK ready") != nil {
+			return
+		}
+		if !expectCAPA(c) {
+			return
+		}
+		serveUserPassSession(c)
+	}()
+
+	host, port := splitHostPortInt(t, ln.Addr().String())
+	client, err := Dial(&Config{
+		Host:   host,
+		Port:   port,
+		User:   "user",
+		Pass:   "pass",
+		Auth:   "user",
+		TLS:    true,
+		CAFile: caFile,
+	})
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	if !client.conn.tls {
+		t.Fatal("client.conn.tls = false after an implicit TLS dial")
+	}
+	if err := client.Quit(); err != nil {
+		t.Fatalf("Quit: %s", err)
+	}
+}
+
+// TestDialSTARTTLS dials a fake POP3 server in plaintext and upgrades via
+// STLS, exercising startTLS and conn.upgrade.
+func TestDialSTARTTLS(t *testing.T) {
+	cert, _ := generateSelfSignedCert(t, "127.0.0.1")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	go func() {
+		defer ln.Close()
+		rawConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer rawConn.Close()
+		c := newConn(rawConn, false, false, 5*time.Second)
+		if c.writeLine("+OK ready") != nil {
+			return
+		}
+		// The client issues STLS right after the greeting, before anything
+		// else -- in particular before CAPA, which only happens once
+		// authenticate() runs post-upgrade.
+		line, err := c.readLine()
+		if err != nil || line != "STLS" {
+			return
+		}
+		if c.writeLine("+OK begin TLS") != nil {
+			return
+		}
+
+		tlsConn := tls.Server(c.transport, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		c.upgrade(tlsConn)
+
+		if !expectCAPA(c) {
+			return
+		}
+		serveUserPassSession(c)
+	}()
+
+	host, port := splitHostPortInt(t, ln.Addr().String())
+	client, err := Dial(&Config{
+		Host:          host,
+		Port:          port,
+		User:          "user",
+		Pass:          "pass",
+		Auth:          "user",
+		STARTTLS:      true,
+		TLSSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	if !client.conn.tls {
+		t.Fatal("client.conn.tls = false after a STARTTLS upgrade")
+	}
+	if err := client.Quit(); err != nil {
+		t.Fatalf("Quit: %s", err)
+	}
+}
+
+// TestBuildTLSConfig covers the ServerName defaulting/override and CAFile
+// loading in buildTLSConfig directly, without needing a live connection.
+func TestBuildTLSConfig(t *testing.T) {
+	cfg, err := buildTLSConfig(&Config{Host: "mail.example.com"})
+	if err != nil {
+		t.Fatalf("buildTLSConfig: %s", err)
+	}
+	if cfg.ServerName != "mail.example.com" {
+		t.Fatalf("ServerName = %q, want %q", cfg.ServerName, "mail.example.com")
+	}
+
+	cfg, err = buildTLSConfig(&Config{Host: "mail.example.com", ServerName: "override.example.com"})
+	if err != nil {
+		t.Fatalf("buildTLSConfig: %s", err)
+	}
+	if cfg.ServerName != "override.example.com" {
+		t.Fatalf("ServerName = %q, want %q", cfg.ServerName, "override.example.com")
+	}
+
+	_, certPEM := generateSelfSignedCert(t, "127.0.0.1")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("write CA file: %s", err)
+	}
+	cfg, err = buildTLSConfig(&Config{Host: "127.0.0.1", CAFile: caFile})
+	if err != nil {
+		t.Fatalf("buildTLSConfig with a valid CA file: %s", err)
+	}
+	if cfg.RootCAs == nil {
+		t.Fatal("RootCAs is nil after loading a CAFile")
+	}
+
+	if _, err := buildTLSConfig(&Config{Host: "127.0.0.1", CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Fatal("buildTLSConfig with a missing CA file succeeded, want an error")
+	}
+}
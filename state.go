@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateEntry records what we know about one message we've previously seen,
+// keyed by its UIDL (RFC 1939 section 7).
+type StateEntry struct {
+	UID       string    `json:"uid"`
+	Size      int       `json:"size"`
+	FirstSeen time.Time `json:"first_seen"`
+	// Warned is true once we've emitted an oversize warning for this
+	// message, so later runs don't repeat it.
+	Warned bool `json:"warned"`
+}
+
+// State is the on-disk seen-list we use to avoid re-warning about messages
+// we've already reported on a previous run.
+type State struct {
+	Messages map[string]*StateEntry `json:"messages"`
+}
+
+// loadState reads the state file at path. A missing file is not an error;
+// it just means we haven't seen any messages yet.
+func loadState(path string) (*State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &State{Messages: map[string]*StateEntry{}}, nil
+		}
+		return nil, err
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	if st.Messages == nil {
+		st.Messages = map[string]*StateEntry{}
+	}
+	return &st, nil
+}
+
+// saveState writes st to path atomically.
+func saveState(path string, st *State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicWriteFile(path, data)
+}
+
+// atomicWriteFile writes data to path atomically, by writing to a temp
+// file in the same directory and renaming it over path, so a crash or
+// concurrent read never sees a half-written file.
+func atomicWriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, ".pop3_check-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
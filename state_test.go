@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoadStateMissingFile checks that a missing state file yields an
+// empty State rather than an error.
+func TestLoadStateMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	st, err := loadState(filepath.Join(dir, "does-not-exist.json"))
+	if err != nil {
+		t.Fatalf("loadState: %s", err)
+	}
+	if st.Messages == nil || len(st.Messages) != 0 {
+		t.Fatalf("loadState returned %+v, want an empty, non-nil Messages map", st)
+	}
+}
+
+// TestLoadStateCorruptJSON checks that invalid JSON in the state file is
+// reported as an error rather than silently discarding previously-warned
+// state.
+func TestLoadStateCorruptJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	if err := ioutil.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatalf("writing corrupt state file: %s", err)
+	}
+	if _, err := loadState(path); err == nil {
+		t.Fatal("loadState with corrupt JSON returned no error")
+	}
+}
+
+// TestSaveStateLoadStateRoundTrip checks that saveState followed by
+// loadState reproduces the original State, including the Warned flag the
+// dedup logic depends on.
+func TestSaveStateLoadStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	want := &State{
+		Messages: map[string]*StateEntry{
+			"uidA": {UID: "uidA", Size: 1000, FirstSeen: time.Now().Truncate(time.Second).UTC(), Warned: true},
+			"uidB": {UID: "uidB", Size: 200, FirstSeen: time.Now().Truncate(time.Second).UTC(), Warned: false},
+		},
+	}
+
+	if err := saveState(path, want); err != nil {
+		t.Fatalf("saveState: %s", err)
+	}
+
+	got, err := loadState(path)
+	if err != nil {
+		t.Fatalf("loadState: %s", err)
+	}
+	if len(got.Messages) != len(want.Messages) {
+		t.Fatalf("loadState returned %d messages, want %d", len(got.Messages), len(want.Messages))
+	}
+	for uid, wantEntry := range want.Messages {
+		gotEntry, ok := got.Messages[uid]
+		if !ok {
+			t.Fatalf("loadState missing entry for %q", uid)
+		}
+		if *gotEntry != *wantEntry {
+			t.Fatalf("loadState entry for %q = %+v, want %+v", uid, gotEntry, wantEntry)
+		}
+	}
+}
+
+// TestAtomicWriteFileReplacesExisting checks that atomicWriteFile
+// overwrites an existing file's contents and leaves no temp file behind.
+func TestAtomicWriteFileReplacesExisting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	if err := ioutil.WriteFile(path, []byte("old contents"), 0o600); err != nil {
+		t.Fatalf("seeding existing file: %s", err)
+	}
+
+	if err := atomicWriteFile(path, []byte("new contents")); err != nil {
+		t.Fatalf("atomicWriteFile: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading file: %s", err)
+	}
+	if string(data) != "new contents" {
+		t.Fatalf("file contents = %q, want %q", data, "new contents")
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading dir: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("dir has %d entries after atomicWriteFile, want 1 (no leftover temp file): %v", len(entries), entries)
+	}
+}
+
+// TestAtomicWriteFileBadDir checks that a write to a non-existent
+// directory fails rather than silently succeeding.
+func TestAtomicWriteFileBadDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nonexistent", "state.json")
+	if err := atomicWriteFile(path, []byte("data")); err == nil {
+		t.Fatal("atomicWriteFile into a non-existent directory returned no error")
+	}
+}